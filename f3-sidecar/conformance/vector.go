@@ -0,0 +1,59 @@
+// Package conformance loads recorded F3 signing vectors for replay against
+// the sidecar's signing path.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Vector is one recorded F3 signing scenario: the manifest and power table
+// in effect, which miner is participating, the serialized gpbft message
+// builder it was asked to sign, and the payload/VRF signatures a correct
+// sidecar must reproduce. ExpectNoPower marks the negative case where the
+// miner is expected to hold no power in the given power table. SignerSeed
+// is the seed the recorded signatures were produced from, so the suite can
+// regenerate the same BLS key instead of signing with an unrelated one.
+type Vector struct {
+	Name                string          `json:"name"`
+	Manifest            json.RawMessage `json:"manifest"`
+	PowerTable          json.RawMessage `json:"power_table"`
+	MinerID             uint64          `json:"miner_id"`
+	MessageBuilderBytes []byte          `json:"message_builder_bytes"`
+	SignerSeed          []byte          `json:"signer_seed"`
+	ExpectedPayloadSig  []byte          `json:"expected_payload_sig"`
+	ExpectedVRFSig      []byte          `json:"expected_vrf_sig"`
+	ExpectNoPower       bool            `json:"expect_no_power"`
+}
+
+// Load reads every *.json file in dir as a Vector. Vectors directories are
+// typically pinned via a submodule or fetched out of band, so a missing dir
+// is returned as-is (os.ErrNotExist) for callers to treat as "nothing to
+// run" rather than a hard failure.
+func Load(dir string) ([]Vector, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var vectors []Vector
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var v Vector
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parsing vector %s: %w", entry.Name(), err)
+		}
+		if v.Name == "" {
+			v.Name = entry.Name()
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/filecoin-project/go-f3/blssig"
+	"github.com/filecoin-project/go-f3/gpbft"
+
+	"github.com/ChainSafe/forest/f3-sidecar/conformance"
+)
+
+// stubSigner signs with an in-process BLS key regenerated from the
+// vector's seed, so the conformance suite needs neither a live Forest
+// wallet nor network access, and reproduces the same key the recorded
+// signatures were signed with.
+type stubSigner struct {
+	verifier *blssig.Verifier
+	key      any
+}
+
+func newStubSigner(seed []byte) (*stubSigner, gpbft.PubKey, error) {
+	v := blssig.VerifierWithKeyOnG1()
+	pub, priv, err := v.GenerateKey(bytes.NewReader(seed))
+	if err != nil {
+		return nil, gpbft.PubKey{}, err
+	}
+	return &stubSigner{verifier: v, key: priv}, pub, nil
+}
+
+func (s *stubSigner) Sign(ctx context.Context, sender gpbft.PubKey, msg []byte) ([]byte, error) {
+	return s.verifier.Sign(ctx, sender, msg, s.key)
+}
+
+// singleSigner satisfies the Signer provider abstraction prepareAndSign
+// consumes, always handing back the same stubbed signer regardless of
+// miner, since conformance vectors pin a single signing key per scenario.
+type singleSigner struct {
+	signer gpbft.Signer
+}
+
+func (s singleSigner) SignerForMiner(context.Context, uint64) (gpbft.Signer, error) {
+	return s.signer, nil
+}
+
+// TestConformanceVectors replays recorded F3 signing inputs through
+// prepareAndSign, the same function participate() calls before handing off
+// to f3Module.Broadcast, and checks the resulting payload/VRF signatures
+// against the expected bytes, including the ErrNoPower negative case.
+//
+// Vectors are pinned out of band (submodule or CI fetch) under
+// CONFORMANCE_VECTORS_DIR; the suite skips, rather than fails, when that
+// directory doesn't exist, and SKIP_CONFORMANCE is an explicit escape
+// hatch for environments without network access to fetch them.
+func TestConformanceVectors(t *testing.T) {
+	if os.Getenv("SKIP_CONFORMANCE") != "" {
+		t.Skip("SKIP_CONFORMANCE set")
+	}
+	dir := os.Getenv("CONFORMANCE_VECTORS_DIR")
+	if dir == "" {
+		dir = "conformance/vectors"
+	}
+	vectors, err := conformance.Load(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Skipf("no conformance vectors at %s", dir)
+		}
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Skip("no conformance vectors found")
+	}
+
+	for _, vec := range vectors {
+		t.Run(vec.Name, func(t *testing.T) {
+			signer, _, err := newStubSigner(vec.SignerSeed)
+			if err != nil {
+				t.Fatalf("generating stub key: %+v", err)
+			}
+
+			msgToSign := new(gpbft.MessageBuilder)
+			if err := msgToSign.UnmarshalCBOR(bytes.NewReader(vec.MessageBuilderBytes)); err != nil {
+				t.Fatalf("decoding message builder: %+v", err)
+			}
+
+			_, payloadSig, vrfSig, err := prepareAndSign(context.Background(), singleSigner{signer: signer}, msgToSign, vec.MinerID)
+			if vec.ExpectNoPower {
+				if !errors.Is(err, gpbft.ErrNoPower) {
+					t.Fatalf("expected ErrNoPower, got %+v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareAndSign: %+v", err)
+			}
+			if !bytes.Equal(payloadSig, vec.ExpectedPayloadSig) {
+				t.Errorf("payload signature mismatch for vector %q", vec.Name)
+			}
+			if !bytes.Equal(vrfSig, vec.ExpectedVRFSig) {
+				t.Errorf("VRF signature mismatch for vector %q", vec.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// LeaderElector decides which sidecar instance actively participates in F3
+// when several run for the same miner set. Run blocks until ctx is
+// canceled; IsLeader may be called concurrently.
+type LeaderElector interface {
+	Run(ctx context.Context)
+	IsLeader() bool
+}
+
+// noopElector is used when HA mode is disabled: this instance is always the
+// leader, preserving today's single-sidecar behavior.
+type noopElector struct{}
+
+func (noopElector) Run(ctx context.Context) { <-ctx.Done() }
+func (noopElector) IsLeader() bool          { return true }
+
+// fileLease is the JSON document written to the shared lease file. Term is
+// raised on every claim so the read-back check in tryAcquireOrRenew can tell
+// our own write from a competitor's; a stale write that lands after that
+// check is not detected.
+type fileLease struct {
+	HolderID  string    `json:"holder_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Term      int64     `json:"term"`
+}
+
+// FileLeaseElector elects a leader using a lease file on shared storage.
+// Whichever instance last wrote a non-expired lease naming itself as
+// holder is the leader. The read-decide-write section is flock-guarded
+// (which only helps same-host races; cross-host exclusivity on NFS without
+// lockd relies on the read-back-after-write check in tryAcquireOrRenew).
+type FileLeaseElector struct {
+	path     string
+	id       string
+	leaseTTL time.Duration
+
+	term int64
+
+	mu       sync.Mutex
+	isLeader bool
+}
+
+func NewFileLeaseElector(path string, id string, leaseTTL time.Duration) *FileLeaseElector {
+	return &FileLeaseElector{path: path, id: id, leaseTTL: leaseTTL}
+}
+
+func (e *FileLeaseElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+func (e *FileLeaseElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		e.tryAcquireOrRenew()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *FileLeaseElector) tryAcquireOrRenew() {
+	lockPath := e.path + ".lock"
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		logger.Warnf("opening lease lock file %s: %+v", lockPath, err)
+		e.setLeader(false)
+		return
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		logger.Warnf("locking lease file %s: %+v", lockPath, err)
+		e.setLeader(false)
+		return
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	now := time.Now()
+	lease, err := readFileLease(e.path)
+	if err == nil && lease.HolderID != e.id && lease.ExpiresAt.After(now) {
+		e.setLeader(false)
+		return
+	}
+	term := e.term + 1
+	if err == nil && lease.Term >= term {
+		term = lease.Term + 1
+	}
+	newLease := fileLease{HolderID: e.id, ExpiresAt: now.Add(e.leaseTTL), Term: term}
+	if err := writeFileLeaseAtomic(e.path, newLease); err != nil {
+		logger.Warnf("claiming lease file %s: %+v", e.path, err)
+		e.setLeader(false)
+		return
+	}
+	e.term = term
+
+	// flock only excludes other processes on the same host; on shared
+	// storage without NLM/lockd it can be a silent no-op across hosts. Read
+	// the lease back and confirm our write actually stuck before declaring
+	// leadership, catching the case where a concurrent writer on another
+	// host won the last-write-wins race despite the lock.
+	readBack, err := readFileLease(e.path)
+	if err != nil || readBack.HolderID != e.id || readBack.Term != term {
+		logger.Warnf("lost lease race on %s after writing term %d", e.path, term)
+		e.setLeader(false)
+		return
+	}
+	e.setLeader(true)
+}
+
+func (e *FileLeaseElector) setLeader(leader bool) {
+	e.mu.Lock()
+	e.isLeader = leader
+	e.mu.Unlock()
+}
+
+func readFileLease(path string) (fileLease, error) {
+	var lease fileLease
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lease, err
+	}
+	err = json.Unmarshal(data, &lease)
+	return lease, err
+}
+
+func writeFileLeaseAtomic(path string, lease fileLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp.%s", path, lease.HolderID)
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// leaseClaim is gossiped over the lease pubsub topic.
+type leaseClaim struct {
+	PeerID    string    `json:"peer_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PubSubLeaseElector elects a leader by gossiping signed lease-claim
+// messages over the sidecar's existing p2p.PubSub, breaking ties
+// deterministically on peer ID so no shared storage is required.
+type PubSubLeaseElector struct {
+	self     peer.ID
+	topic    *pubsub.Topic
+	sub      *pubsub.Subscription
+	leaseTTL time.Duration
+
+	mu          sync.Mutex
+	leader      peer.ID
+	leaderUntil time.Time
+	settled     bool
+}
+
+func NewPubSubLeaseElector(h host.Host, ps *pubsub.PubSub, networkName string, leaseTTL time.Duration) (*PubSubLeaseElector, error) {
+	topic, err := ps.Join(fmt.Sprintf("/f3/ha-lease/%s", networkName))
+	if err != nil {
+		return nil, err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+	return &PubSubLeaseElector{self: h.ID(), topic: topic, sub: sub, leaseTTL: leaseTTL}, nil
+}
+
+func (e *PubSubLeaseElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.settled && e.leader == e.self && e.leaderUntil.After(time.Now())
+}
+
+// applyClaim is the single place leadership state changes, whether the
+// claim came from a remote peer via readLoop or from ourselves via
+// maybeClaim, so self-claims are subject to exactly the same lowest-ID
+// tie-break as everyone else's.
+func (e *PubSubLeaseElector) applyClaim(claimant peer.ID, expiresAt time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leaderUntil.Before(time.Now()) || claimant.String() < e.leader.String() {
+		if claimant != e.leader {
+			e.settled = false
+		}
+		e.leader = claimant
+		e.leaderUntil = expiresAt
+	}
+}
+
+func (e *PubSubLeaseElector) Run(ctx context.Context) {
+	go e.readLoop(ctx)
+	ticker := time.NewTicker(e.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		e.maybeClaim(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *PubSubLeaseElector) maybeClaim(ctx context.Context) {
+	e.mu.Lock()
+	shouldClaim := e.leader == e.self || e.leaderUntil.Before(time.Now())
+	e.mu.Unlock()
+	if !shouldClaim {
+		return
+	}
+	claim := leaseClaim{PeerID: e.self.String(), ExpiresAt: time.Now().Add(e.leaseTTL)}
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return
+	}
+	if err := e.topic.Publish(ctx, data); err != nil {
+		logger.Warnf("publishing HA lease claim: %+v", err)
+		return
+	}
+	e.applyClaim(e.self, claim.ExpiresAt)
+
+	// Don't trust our own claim as leadership yet: give it one propagation
+	// interval to reach the rest of the mesh so a lower-ID competitor's
+	// claim, processed through the same applyClaim via readLoop, has a
+	// chance to override ours first. Without this, every contending
+	// instance would believe itself leader the instant it publishes.
+	select {
+	case <-time.After(e.leaseTTL / 3):
+	case <-ctx.Done():
+		return
+	}
+	e.mu.Lock()
+	if e.leader == e.self {
+		e.settled = true
+	}
+	e.mu.Unlock()
+}
+
+func (e *PubSubLeaseElector) readLoop(ctx context.Context) {
+	for {
+		msg, err := e.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		var claim leaseClaim
+		if err := json.Unmarshal(msg.Data, &claim); err != nil {
+			continue
+		}
+		// Trust the pubsub-authenticated sender, not the self-reported
+		// PeerID in the payload, so a peer can't name a lower PeerID than
+		// its own to win the tie-break below.
+		claimant := msg.GetFrom()
+		if claim.PeerID != claimant.String() {
+			logger.Warnf("HA lease claim from %s names mismatched peer %s, dropping", claimant, claim.PeerID)
+			continue
+		}
+		e.applyClaim(claimant, claim.ExpiresAt)
+	}
+}
+
+// haF3ServerHandler wraps F3ServerHandler to additionally expose the
+// sidecar's current HA role over the same JSON-RPC endpoint, without
+// changing F3ServerHandler itself.
+type haF3ServerHandler struct {
+	*F3ServerHandler
+	elector LeaderElector
+}
+
+// IsLeader reports whether this sidecar instance currently holds the F3
+// participation lease.
+func (h *haF3ServerHandler) IsLeader(context.Context) (bool, error) {
+	return h.elector.IsLeader(), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"contrib.go.opencensus.io/exporter/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Metric tag keys and measures for the F3 sidecar, recorded via OpenCensus
+// and exported to Prometheus, mirroring the approach used by the Lotus
+// testkit miner role.
+var (
+	keyMiner = tag.MustNewKey("miner")
+
+	messagesToSignTotal = stats.Int64("f3/messages_to_sign_total", "MessagesToSign values received from go-f3", stats.UnitDimensionless)
+	signSuccessTotal    = stats.Int64("f3/sign_success_total", "Successful per-miner signing attempts", stats.UnitDimensionless)
+	signFailureTotal    = stats.Int64("f3/sign_failure_total", "Failed per-miner signing attempts", stats.UnitDimensionless)
+	signLatencySeconds  = stats.Float64("f3/sign_latency_seconds", "Latency of a per-miner signing attempt", stats.UnitSeconds)
+	rebroadcastTotal    = stats.Int64("f3/rebroadcast_total", "Rebroadcast attempts from the last-message goroutine", stats.UnitDimensionless)
+	manifestSource      = stats.Int64("f3/manifest_source", "Current manifest source (0=static, 1=contract)", stats.UnitDimensionless)
+	contractPollSuccess = stats.Int64("f3/contract_manifest_poll_success_total", "Successful contract manifest polls", stats.UnitDimensionless)
+	contractPollFailure = stats.Int64("f3/contract_manifest_poll_failure_total", "Failed contract manifest polls", stats.UnitDimensionless)
+	p2pPeerCount        = stats.Int64("f3/p2p_peer_count", "Current libp2p peer count", stats.UnitDimensionless)
+	rpcReconnectTotal   = stats.Int64("f3/forest_rpc_reconnect_total", "Forest RPC client reconnect attempts", stats.UnitDimensionless)
+	haIsLeader          = stats.Int64("f3/ha_is_leader", "Whether this instance currently holds the F3 HA leader lease", stats.UnitDimensionless)
+)
+
+var defaultViews = []*view.View{
+	{Measure: messagesToSignTotal, Aggregation: view.Count()},
+	{Measure: signSuccessTotal, TagKeys: []tag.Key{keyMiner}, Aggregation: view.Count()},
+	{Measure: signFailureTotal, TagKeys: []tag.Key{keyMiner}, Aggregation: view.Count()},
+	{Measure: signLatencySeconds, TagKeys: []tag.Key{keyMiner}, Aggregation: view.Distribution(0, .1, .25, .5, 1, 2.5, 5, 10)},
+	{Measure: rebroadcastTotal, TagKeys: []tag.Key{keyMiner}, Aggregation: view.Count()},
+	{Measure: manifestSource, Aggregation: view.LastValue()},
+	{Measure: contractPollSuccess, Aggregation: view.Count()},
+	{Measure: contractPollFailure, Aggregation: view.Count()},
+	{Measure: p2pPeerCount, Aggregation: view.LastValue()},
+	{Measure: rpcReconnectTotal, Aggregation: view.Count()},
+	{Measure: haIsLeader, Aggregation: view.LastValue()},
+}
+
+// registerMetrics registers the sidecar's OpenCensus views and returns a
+// Prometheus exporter that can be mounted as an http.Handler on /metrics.
+func registerMetrics() (*prometheus.Exporter, error) {
+	if err := view.Register(defaultViews...); err != nil {
+		return nil, err
+	}
+	return prometheus.NewExporter(prometheus.Options{
+		Namespace: "f3_sidecar",
+		Registry:  promclient.NewRegistry(),
+	})
+}
+
+// RecordContractManifestPoll records the outcome of a contract manifest
+// fetch. It is called around NewContractManifestProvider's initial fetch;
+// recurring background polls happen inside go-f3 itself and aren't
+// observable from here, so this metric only reflects fetches on (re)build.
+func RecordContractManifestPoll(success bool) {
+	if success {
+		stats.Record(context.Background(), contractPollSuccess.M(1))
+	} else {
+		stats.Record(context.Background(), contractPollFailure.M(1))
+	}
+}
+
+func recordSignResult(ctx context.Context, miner uint64, success bool, latencySeconds float64) {
+	ctx, err := tag.New(ctx, tag.Upsert(keyMiner, minerWalletAddress(miner)))
+	if err != nil {
+		return
+	}
+	if success {
+		stats.Record(ctx, signSuccessTotal.M(1), signLatencySeconds.M(latencySeconds))
+	} else {
+		stats.Record(ctx, signFailureTotal.M(1), signLatencySeconds.M(latencySeconds))
+	}
+}
+
+func recordRebroadcast(ctx context.Context, miner uint64) {
+	ctx, err := tag.New(ctx, tag.Upsert(keyMiner, minerWalletAddress(miner)))
+	if err != nil {
+		return
+	}
+	stats.Record(ctx, rebroadcastTotal.M(1))
+}
+
+// healthState tracks the liveness/readiness signals exposed over HTTP so
+// standard Filecoin ops tooling can probe the sidecar the same way it
+// probes lotus-miner or forest itself.
+type healthState struct {
+	forestReachable atomic.Bool
+	f3Started       atomic.Bool
+}
+
+func (h *healthState) healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (h *healthState) readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	if h.forestReachable.Load() && h.f3Started.Load() {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready"))
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte("not ready"))
+}
+
+// startMetricsServer mounts /metrics, /healthz and /readyz on listenAddr and
+// serves them in the background. It returns the *healthState so callers can
+// flip the readiness signals as the sidecar progresses through startup.
+func startMetricsServer(listenAddr string) (*healthState, error) {
+	exporter, err := registerMetrics()
+	if err != nil {
+		return nil, err
+	}
+	health := &healthState{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.HandleFunc("/healthz", health.healthzHandler)
+	mux.HandleFunc("/readyz", health.readyzHandler)
+	srv := &http.Server{Addr: listenAddr, Handler: mux}
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			logger.Warnf("metrics server stopped: %+v", err)
+		}
+	}()
+	return health, nil
+}
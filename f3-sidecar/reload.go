@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/filecoin-project/go-f3"
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-f3/manifest"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/ipfs/go-cid"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"go.opencensus.io/stats"
+)
+
+// reloadConfig holds the subset of sidecar configuration that can change
+// without a restart. NetworkName isn't here: it's derived from the RPC
+// endpoint, and changing it mid-run is refused rather than supported.
+type reloadConfig struct {
+	RpcEndpoint                         string
+	Jwt                                 string
+	InitialPowerTable                   string
+	BootstrapEpoch                      int64
+	Finality                            int64
+	ContractManifestPollIntervalSeconds uint64
+}
+
+// builtState is the result of building a Forest RPC client, manifest
+// provider and F3 instance from a reloadConfig, before it has been swapped
+// into the running supervisor.
+type builtState struct {
+	network          string
+	ec               *ForestEC
+	ecCloser         jsonrpc.ClientCloser
+	manifestProvider manifest.ManifestProvider
+	f3Module         *f3.F3
+	ds               *leveldb.Datastore
+	dsPath           string
+}
+
+// close releases everything build() opened for this generation. Callers
+// must have already stopped f3Module, since it may still be writing to ds.
+func (b *builtState) close() {
+	b.ecCloser()
+	b.ec.Close()
+	if err := b.ds.Close(); err != nil {
+		logger.Warnf("closing datastore %s: %+v", b.dsPath, err)
+	}
+}
+
+// supervisor owns the parts of the sidecar that Reload can rebuild: the
+// Forest RPC client, the manifest provider, and the running f3.F3 instance.
+// The libp2p host/pubsub and BLS verifier are long-lived and are not
+// rebuilt on reload.
+type supervisor struct {
+	f3Root string
+	host   host.Host
+	pubsub *pubsub.PubSub
+	verif  gpbft.Verifier
+
+	generation atomic.Uint64
+
+	mu      sync.RWMutex
+	cfg     reloadConfig
+	network string
+	state   *builtState
+	changed chan struct{}
+}
+
+func newSupervisor(f3Root string, h host.Host, ps *pubsub.PubSub, verif gpbft.Verifier) *supervisor {
+	return &supervisor{f3Root: f3Root, host: h, pubsub: ps, verif: verif, changed: make(chan struct{})}
+}
+
+// useStaticManifest reports whether m is already complete enough to serve
+// as-is, as opposed to needing the contract manifest provider to fill it
+// in (e.g. NetworkName unset because the chain hasn't bootstrapped F3 yet).
+func useStaticManifest(m manifest.Manifest) bool {
+	return m.Validate() == nil
+}
+
+// build dials cfg.RpcEndpoint fresh, assembles the manifest provider it
+// implies, and starts a new f3.F3 instance against it. It does not touch
+// the supervisor's current state, so the caller can validate the result
+// (e.g. the NetworkName safety check) before swapping it in.
+func (s *supervisor) build(ctx context.Context, cfg reloadConfig) (*builtState, error) {
+	api := FilecoinApi{}
+	closer, err := jsonrpc.NewClient(context.Background(), cfg.RpcEndpoint, "Filecoin", &api, nil)
+	if err != nil {
+		return nil, err
+	}
+	network, err := api.StateNetworkName(ctx)
+	if err != nil {
+		closer()
+		return nil, fmt.Errorf("dialing Forest RPC: %w", err)
+	}
+	versionInfo, err := api.Version(ctx)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+
+	ecVal, err := NewForestEC(cfg.RpcEndpoint, cfg.Jwt)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+	ec := &ecVal
+	if _, err := ec.f3api.ProtectPeer(ctx, s.host.ID()); err != nil {
+		closer()
+		ec.Close()
+		return nil, err
+	}
+
+	// Each generation gets its own datastore directory: goleveldb holds an
+	// exclusive lock on it for as long as it's open, and the currently
+	// running generation's F3 instance is still using its own datastore
+	// when build() runs for a reload, so reusing one fixed path would fail
+	// to acquire the lock on every reload after the first.
+	dsPath := filepath.Join(s.f3Root, fmt.Sprintf("db-%d", s.generation.Add(1)))
+	ds, err := leveldb.NewDatastore(dsPath, nil)
+	if err != nil {
+		closer()
+		ec.Close()
+		return nil, err
+	}
+
+	m := manifest.LocalDevnetManifest()
+	switch initialPowerTable, err := cid.Parse(cfg.InitialPowerTable); {
+	case err == nil && isCidDefined(initialPowerTable):
+		m.InitialPowerTable = initialPowerTable
+	default:
+		m.InitialPowerTable = cid.Undef
+	}
+	m.NetworkName = gpbft.NetworkName(network)
+	blockDelay := time.Duration(versionInfo.BlockDelay) * time.Second
+	m.EC.Period = blockDelay
+	m.EC.HeadLookback = 4
+	m.EC.Finality = cfg.Finality
+	m.EC.Finalize = true
+	m.CatchUpAlignment = blockDelay / 2
+	m.BootstrapEpoch = cfg.BootstrapEpoch
+	m.CertificateExchange.MinimumPollInterval = blockDelay
+	m.CertificateExchange.MaximumPollInterval = 4 * blockDelay
+
+	var manifestProvider manifest.ManifestProvider
+	if useStaticManifest(m) {
+		logger.Infoln("Using static manifest")
+		manifestProvider, err = manifest.NewStaticManifestProvider(m)
+		if err != nil {
+			closer()
+			ec.Close()
+			ds.Close()
+			return nil, err
+		}
+		stats.Record(ctx, manifestSource.M(0))
+	} else {
+		logger.Infoln("Using contract manifest")
+		manifestProvider, err = NewContractManifestProvider(m, cfg.ContractManifestPollIntervalSeconds, &ec.f3api)
+		RecordContractManifestPoll(err == nil)
+		if err != nil {
+			closer()
+			ec.Close()
+			ds.Close()
+			return nil, err
+		}
+		stats.Record(ctx, manifestSource.M(1))
+	}
+
+	f3Module, err := f3.New(ctx, manifestProvider, ds, s.host, s.pubsub, s.verif, ec, s.f3Root)
+	if err != nil {
+		closer()
+		ec.Close()
+		ds.Close()
+		return nil, err
+	}
+	if err := f3Module.Start(ctx); err != nil {
+		closer()
+		ec.Close()
+		ds.Close()
+		return nil, err
+	}
+
+	return &builtState{
+		network:          network,
+		ec:               ec,
+		ecCloser:         closer,
+		manifestProvider: manifestProvider,
+		f3Module:         f3Module,
+		ds:               ds,
+		dsPath:           dsPath,
+	}, nil
+}
+
+// Start performs the first build and installs it as the running state.
+func (s *supervisor) Start(ctx context.Context, cfg reloadConfig) error {
+	built, err := s.build(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	s.network = built.network
+	s.state = built
+	s.mu.Unlock()
+	return nil
+}
+
+// Reload rebuilds the Forest RPC client, manifest provider and F3 instance
+// from cfg and swaps them in atomically, draining the outgoing instance's
+// MessagesToSign() and re-protecting our peer under the new RPC client. It
+// refuses reloads that would change NetworkName mid-run, since every F3
+// participant on the network must agree on it.
+func (s *supervisor) Reload(ctx context.Context, cfg reloadConfig) error {
+	built, err := s.build(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("building reloaded state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.network != "" && built.network != s.network {
+		built.f3Module.Stop(ctx)
+		built.close()
+		if err := os.RemoveAll(built.dsPath); err != nil {
+			logger.Warnf("removing rejected datastore %s: %+v", built.dsPath, err)
+		}
+		return fmt.Errorf("refusing reload: NetworkName would change from %q to %q", s.network, built.network)
+	}
+
+	old := s.state
+	drainMessagesToSign(old.f3Module)
+
+	s.cfg = cfg
+	s.network = built.network
+	s.state = built
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	if old != nil {
+		old.f3Module.Stop(ctx)
+		old.close()
+		if err := os.RemoveAll(old.dsPath); err != nil {
+			logger.Warnf("removing previous generation datastore %s: %+v", old.dsPath, err)
+		}
+	}
+	logger.Infoln("F3 sidecar reloaded configuration")
+	return nil
+}
+
+func drainMessagesToSign(f3Module *f3.F3) {
+	if f3Module == nil {
+		return
+	}
+	for {
+		select {
+		case <-f3Module.MessagesToSign():
+		default:
+			return
+		}
+	}
+}
+
+// Current returns the currently active Forest RPC client and F3 instance.
+func (s *supervisor) Current() (*ForestEC, *f3.F3) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.ec, s.state.f3Module
+}
+
+// Changed returns a channel that is closed once the next Reload swaps in
+// new state. Prefer Snapshot over pairing this with Current: fetching them
+// via two separate locks leaves a window where a Reload between the calls
+// hands back a *new* Changed channel alongside the *old* F3 instance, which
+// won't close until the reload after that.
+func (s *supervisor) Changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changed
+}
+
+// Snapshot returns the currently active Forest RPC client and F3 instance
+// together with the Changed channel for that same state, all under one
+// lock, so a caller selecting on them can't be handed a channel instance
+// that was never paired with the F3 instance it's also holding.
+func (s *supervisor) Snapshot() (*ForestEC, *f3.F3, <-chan struct{}) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.ec, s.state.f3Module, s.changed
+}
+
+// reloadHandler exposes F3.Reload as a JSON-RPC admin method so operators
+// can change the manifest source, bootstrap epoch, finality, or Forest RPC
+// endpoint without restarting the sidecar.
+type reloadHandler struct {
+	sup *supervisor
+}
+
+func (h *reloadHandler) Reload(ctx context.Context, cfg reloadConfig) error {
+	return h.sup.Reload(ctx, cfg)
+}
+
+// watchReload watches configPath (if non-empty) for changes and listens for
+// SIGHUP, reloading the supervisor from the file on either trigger.
+func watchReload(ctx context.Context, sup *supervisor, configPath string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	var lastMod time.Time
+	checkFile := func(force bool) {
+		if len(configPath) == 0 {
+			return
+		}
+		info, err := os.Stat(configPath)
+		if err != nil {
+			logger.Warnf("stat reload config %s: %+v", configPath, err)
+			return
+		}
+		if !force && !info.ModTime().After(lastMod) {
+			return
+		}
+		lastMod = info.ModTime()
+		cfg, err := readReloadConfig(configPath)
+		if err != nil {
+			logger.Warnf("reading reload config %s: %+v", configPath, err)
+			return
+		}
+		if err := sup.Reload(ctx, cfg); err != nil {
+			logger.Warnf("reload from %s: %+v", configPath, err)
+		}
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			logger.Infoln("SIGHUP received, reloading F3 sidecar configuration")
+			checkFile(true)
+		case <-ticker.C:
+			checkFile(false)
+		}
+	}
+}
+
+func readReloadConfig(path string) (reloadConfig, error) {
+	var cfg reloadConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	return cfg, err
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-f3/manifest"
+)
+
+// TestUseStaticManifest covers the predicate build() uses to decide between
+// a static and a contract manifest provider on reload. Exercising build()
+// itself end-to-end (toggling between manifests while the sidecar keeps
+// serving JSON-RPC) would additionally require a live Forest RPC endpoint
+// and FilecoinApi/ForestEC, which aren't available in this package's test
+// environment, so this test is scoped to the selection logic alone.
+func TestUseStaticManifest(t *testing.T) {
+	m := manifest.LocalDevnetManifest()
+	m.NetworkName = gpbft.NetworkName("test")
+	if !useStaticManifest(m) {
+		t.Error("expected a fully populated manifest to validate as static")
+	}
+
+	m.NetworkName = ""
+	if useStaticManifest(m) {
+		t.Error("expected a manifest missing NetworkName to require the contract provider")
+	}
+}
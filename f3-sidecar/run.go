@@ -6,19 +6,27 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"path/filepath"
 	"time"
 
 	"github.com/filecoin-project/go-f3"
 	"github.com/filecoin-project/go-f3/blssig"
 	"github.com/filecoin-project/go-f3/gpbft"
-	"github.com/filecoin-project/go-f3/manifest"
 	"github.com/filecoin-project/go-jsonrpc"
-	"github.com/ipfs/go-cid"
-	leveldb "github.com/ipfs/go-ds-leveldb"
+	"go.opencensus.io/stats"
 )
 
-func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint string, initialPowerTable string, bootstrapEpoch int64, finality int64, f3Root string, contract_manifest_poll_interval_seconds uint64) error {
+func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint string, initialPowerTable string, bootstrapEpoch int64, finality int64, f3Root string, contract_manifest_poll_interval_seconds uint64, remoteSignerUrl string, remoteSignerToken string, metricsListen string, haBackend string, haLeaseFile string, haLeaseTTLSeconds uint64, reloadConfigPath string) error {
+	var health *healthState
+	if len(metricsListen) > 0 {
+		var err error
+		health, err = startMetricsServer(metricsListen)
+		if err != nil {
+			return err
+		}
+	} else {
+		health = &healthState{}
+	}
+
 	api := FilecoinApi{}
 	isJwtProvided := len(jwt) > 0
 	closer, err := jsonrpc.NewClient(context.Background(), rpcEndpoint, "Filecoin", &api, nil)
@@ -31,9 +39,11 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 		network, err = api.StateNetworkName(ctx)
 		if err == nil {
 			logger.Infoln("Forest RPC server is online")
+			health.forestReachable.Store(true)
 			break
 		} else {
 			logger.Warnln("waiting for Forest RPC server")
+			stats.Record(ctx, rpcReconnectTotal.M(1))
 			time.Sleep(5 * time.Second)
 		}
 	}
@@ -46,72 +56,88 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 	if err != nil {
 		return err
 	}
-	ec, err := NewForestEC(rpcEndpoint, jwt)
-	if err != nil {
-		return err
-	}
-	defer ec.Close()
-	if _, err = ec.f3api.ProtectPeer(ctx, p2p.Host.ID()); err != nil {
-		return err
-	}
 	err = p2p.Host.Connect(ctx, listenAddrs)
 	if err != nil {
 		return err
 	}
-	ds, err := leveldb.NewDatastore(filepath.Join(f3Root, "db"), nil)
-	if err != nil {
-		return err
-	}
 	verif := blssig.VerifierWithKeyOnG1()
-	m := manifest.LocalDevnetManifest()
-	switch initialPowerTable, err := cid.Parse(initialPowerTable); {
-	case err == nil && isCidDefined(initialPowerTable):
-		logger.Infof("InitialPowerTable is %s", initialPowerTable)
-		m.InitialPowerTable = initialPowerTable
-	default:
-		logger.Warn("InitialPowerTable is undefined")
-		m.InitialPowerTable = cid.Undef
+
+	sup := newSupervisor(f3Root, p2p.Host, p2p.PubSub, verif)
+	reloadCfg := reloadConfig{
+		RpcEndpoint:                          rpcEndpoint,
+		Jwt:                                  jwt,
+		InitialPowerTable:                    initialPowerTable,
+		BootstrapEpoch:                       bootstrapEpoch,
+		Finality:                             finality,
+		ContractManifestPollIntervalSeconds:  contract_manifest_poll_interval_seconds,
 	}
-	m.NetworkName = gpbft.NetworkName(network)
-	versionInfo, err := api.Version(ctx)
-	if err != nil {
+	if err := sup.Start(ctx, reloadCfg); err != nil {
 		return err
 	}
+	health.f3Started.Store(true)
+	go watchReload(ctx, sup, reloadConfigPath)
 
-	blockDelay := time.Duration(versionInfo.BlockDelay) * time.Second
-	m.EC.Period = blockDelay
-	m.EC.HeadLookback = 4
-	m.EC.Finality = finality
-	m.EC.Finalize = true
-	m.CatchUpAlignment = blockDelay / 2
-	m.BootstrapEpoch = bootstrapEpoch
-	m.CertificateExchange.MinimumPollInterval = blockDelay
-	m.CertificateExchange.MaximumPollInterval = 4 * blockDelay
-
-	var manifestProvider manifest.ManifestProvider
-	if err := m.Validate(); err == nil {
-		logger.Infoln("Using static manifest")
-		if manifestProvider, err = manifest.NewStaticManifestProvider(m); err != nil {
-			return err
+	go func() {
+		for {
+			stats.Record(ctx, p2pPeerCount.M(int64(len(p2p.Host.Network().Peers()))))
+			time.Sleep(15 * time.Second)
 		}
-	} else {
-		logger.Infoln("Using contract manifest")
-		if manifestProvider, err = NewContractManifestProvider(m, contract_manifest_poll_interval_seconds, &ec.f3api); err != nil {
-			return err
+	}()
+
+	var elector LeaderElector = noopElector{}
+	switch haBackend {
+	case "file", "pubsub":
+		if haLeaseTTLSeconds == 0 {
+			return fmt.Errorf("ha-lease-ttl-seconds must be positive when ha-backend=%q", haBackend)
 		}
+		if haBackend == "file" {
+			logger.Infof("HA mode enabled, file lease backend at %s", haLeaseFile)
+			elector = NewFileLeaseElector(haLeaseFile, p2p.Host.ID().String(), time.Duration(haLeaseTTLSeconds)*time.Second)
+		} else {
+			logger.Infoln("HA mode enabled, pubsub lease backend")
+			if elector, err = NewPubSubLeaseElector(p2p.Host, p2p.PubSub, network, time.Duration(haLeaseTTLSeconds)*time.Second); err != nil {
+				return err
+			}
+		}
+	case "", "none":
+		// HA disabled, this instance is always the leader.
+	default:
+		return fmt.Errorf("unknown HA backend %q", haBackend)
 	}
-	f3Module, err := f3.New(ctx, manifestProvider, ds,
-		p2p.Host, p2p.PubSub, verif, &ec, f3Root)
-	if err != nil {
-		return err
-	}
-	if err := f3Module.Start(ctx); err != nil {
-		return err
+	go elector.Run(ctx)
+	go func() {
+		for {
+			leader := int64(0)
+			if elector.IsLeader() {
+				leader = 1
+			}
+			stats.Record(ctx, haIsLeader.M(leader))
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	var signerProvider Signer = NewForestRPCSigner(func() *ForestEC {
+		ec, _ := sup.Current()
+		return ec
+	})
+	if len(remoteSignerUrl) > 0 {
+		remoteSigner, err := NewRemoteWalletSigner(ctx, remoteSignerUrl, remoteSignerToken)
+		if err != nil {
+			return err
+		}
+		defer remoteSigner.Close()
+		logger.Infoln("Remote signer configured, falling back to Forest wallet for unknown miners")
+		signerProvider = NewFallbackSigner(remoteSigner, signerProvider)
 	}
 
+	// The JSON-RPC handler is bound to the F3 instance active at startup;
+	// only the manifest provider, Forest RPC client and signing path are
+	// hot-swapped on reload.
+	_, initialF3Module := sup.Current()
 	rpcServer := jsonrpc.NewServer()
-	serverHandler := &F3ServerHandler{f3Module}
+	serverHandler := &haF3ServerHandler{F3ServerHandler: &F3ServerHandler{initialF3Module}, elector: elector}
 	rpcServer.Register("Filecoin", serverHandler)
+	rpcServer.Register("F3", &reloadHandler{sup: sup})
 	srv := &http.Server{
 		Handler: rpcServer,
 	}
@@ -138,15 +164,18 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 				// This is to avoid a deadlock situation where everyone is waiting
 				// for the next round to participate, but we'll never get there
 				// because not enough participants acted in the current round.
-				if lastMsgToSign != nil && lastMsgToSignTimestamp.Add(10*time.Second).Before(time.Now()) {
+				if elector.IsLeader() && lastMsgToSign != nil && lastMsgToSignTimestamp.Add(10*time.Second).Before(time.Now()) {
+					ec, f3Module := sup.Current()
 					if miners, err := ec.f3api.GetParticipatingMinerIDs(ctx); err == nil {
 						for _, miner := range miners {
 							if _, ok := lastMsgSigningMiners[miner]; ok {
 								continue
-							} else if err := participate(ctx, f3Module, &ec, lastMsgToSign, miner); err != nil {
+							} else if err := participate(ctx, f3Module, signerProvider, lastMsgToSign, miner); err != nil {
+								recordRebroadcast(ctx, miner)
 								logger.Warn(err)
 							} else {
 								lastMsgSigningMiners[miner] = struct{}{}
+								recordRebroadcast(ctx, miner)
 							}
 						}
 					}
@@ -158,7 +187,17 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 	}
 
 	for {
-		msgToSign := <-f3Module.MessagesToSign()
+		ec, f3Module, changed := sup.Snapshot()
+		var msgToSign *gpbft.MessageBuilder
+		select {
+		case msgToSign = <-f3Module.MessagesToSign():
+		case <-changed:
+			// A reload swapped in new state while we were blocked on the
+			// old (now-stopped) F3 instance's channel; re-fetch sup.Snapshot()
+			// instead of reading from it again.
+			continue
+		}
+		stats.Record(ctx, messagesToSignTotal.M(1))
 		lastMsgToSignTimestamp = time.Now()
 		lastMsgToSign = msgToSign
 		miners, err := ec.f3api.GetParticipatingMinerIDs(ctx)
@@ -170,9 +209,12 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 		if !isJwtProvided && len(miners) > 0 {
 			logger.Warn("Unable to sign messages, jwt for Forest RPC endpoint is not provided.")
 		}
-		if isJwtProvided && msgToSign != nil {
+		if isJwtProvided && msgToSign != nil && !elector.IsLeader() {
+			logger.Debugln("not the HA leader, skipping participation this round")
+		}
+		if isJwtProvided && msgToSign != nil && elector.IsLeader() {
 			for _, miner := range miners {
-				if err := participate(ctx, f3Module, &ec, msgToSign, miner); err != nil {
+				if err := participate(ctx, f3Module, signerProvider, msgToSign, miner); err != nil {
 					logger.Warn(err)
 				} else {
 					lastMsgSigningMiners[miner] = struct{}{}
@@ -182,19 +224,40 @@ func run(ctx context.Context, rpcEndpoint string, jwt string, f3RpcEndpoint stri
 	}
 }
 
-func participate(ctx context.Context, f3Module *f3.F3, signer gpbft.Signer, msgToSign *gpbft.MessageBuilder, miner uint64) error {
-	signatureBuilder, err := msgToSign.PrepareSigningInputs(gpbft.ActorID(miner))
+// prepareAndSign resolves a miner's signer and runs the PrepareSigningInputs
+// + Sign path, the part of participation the conformance suite replays
+// against recorded vectors. A nil signatureBuilder means a fatal error
+// before signing was attempted; a non-nil signatureBuilder with a non-nil
+// err means signing itself failed but the (empty) signatures may still be
+// broadcast, matching how participate has always handled Sign errors.
+func prepareAndSign(ctx context.Context, signerProvider Signer, msgToSign *gpbft.MessageBuilder, miner uint64) (signatureBuilder *gpbft.SignatureBuilder, payloadSig []byte, vrfSig []byte, err error) {
+	signatureBuilder, err = msgToSign.PrepareSigningInputs(gpbft.ActorID(miner))
 	if err != nil {
 		if errors.Is(err, gpbft.ErrNoPower) {
-			// we don't have any power in F3, continue
-			return fmt.Errorf("no power to participate in F3: %+v", err)
-		} else {
-			return fmt.Errorf("preparing signing inputs: %+v", err)
+			return nil, nil, nil, fmt.Errorf("no power to participate in F3: %w", err)
 		}
+		return nil, nil, nil, fmt.Errorf("preparing signing inputs: %w", err)
+	}
+	signer, err := signerProvider.SignerForMiner(ctx, miner)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("resolving signer for miner %d: %w", miner, err)
+	}
+	signStart := time.Now()
+	payloadSig, vrfSig, err = signatureBuilder.Sign(ctx, signer)
+	recordSignResult(ctx, miner, err == nil, time.Since(signStart).Seconds())
+	if err != nil {
+		return signatureBuilder, payloadSig, vrfSig, fmt.Errorf("signing message: %w", err)
+	}
+	return signatureBuilder, payloadSig, vrfSig, nil
+}
+
+func participate(ctx context.Context, f3Module *f3.F3, signerProvider Signer, msgToSign *gpbft.MessageBuilder, miner uint64) error {
+	signatureBuilder, payloadSig, vrfSig, err := prepareAndSign(ctx, signerProvider, msgToSign, miner)
+	if signatureBuilder == nil {
+		return err
 	}
-	payloadSig, vrfSig, err := signatureBuilder.Sign(ctx, signer)
 	if err != nil {
-		logger.Warnf("signing message: %+v", err)
+		logger.Warnf("%+v", err)
 	}
 	logger.Debugf("miner with id %d is sending message in F3", miner)
 	f3Module.Broadcast(ctx, signatureBuilder, payloadSig, vrfSig)
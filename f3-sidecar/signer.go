@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-jsonrpc"
+)
+
+// Signer is the provider abstraction that participate() consumes to resolve
+// the gpbft.Signer backend for a given miner actor ID.
+type Signer interface {
+	SignerForMiner(ctx context.Context, miner uint64) (gpbft.Signer, error)
+}
+
+// ForestRPCSigner signs with whichever key the miner has registered in the
+// Forest wallet. currentEC is re-resolved on every call so it keeps signing
+// against the right client across a hot reload.
+type ForestRPCSigner struct {
+	currentEC func() *ForestEC
+}
+
+func NewForestRPCSigner(currentEC func() *ForestEC) *ForestRPCSigner {
+	return &ForestRPCSigner{currentEC: currentEC}
+}
+
+func (s *ForestRPCSigner) SignerForMiner(_ context.Context, _ uint64) (gpbft.Signer, error) {
+	return s.currentEC(), nil
+}
+
+// MsgType mirrors Lotus's api.MsgType.
+type MsgType string
+
+const (
+	MTUnknown   MsgType = "unknown"
+	MTF3Message MsgType = "f3message"
+)
+
+// MsgMeta mirrors Lotus's api.MsgMeta.
+type MsgMeta struct {
+	Type  MsgType
+	Extra []byte
+}
+
+// Signature mirrors Lotus's crypto.Signature.
+type Signature struct {
+	Type byte
+	Data []byte
+}
+
+// walletApi is the subset of Lotus's Wallet JSON-RPC API that F3 signing needs.
+type walletApi struct {
+	WalletHas  func(ctx context.Context, addr string) (bool, error)
+	WalletSign func(ctx context.Context, addr string, msg []byte, meta MsgMeta) (*Signature, error)
+	WalletList func(ctx context.Context) ([]string, error)
+}
+
+// RemoteWalletSigner signs gpbft messages via WalletSign on an external
+// signer daemon (e.g. lotus-wallet, a KMS bridge, or an HSM shim) speaking
+// Lotus's Wallet JSON-RPC API, authenticated with a bearer token.
+type RemoteWalletSigner struct {
+	api    walletApi
+	closer jsonrpc.ClientCloser
+}
+
+func NewRemoteWalletSigner(ctx context.Context, url string, token string) (*RemoteWalletSigner, error) {
+	headers := http.Header{"Authorization": []string{"Bearer " + token}}
+	var api walletApi
+	closer, err := jsonrpc.NewClient(ctx, url, "Filecoin", &api, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteWalletSigner{api: api, closer: closer}, nil
+}
+
+func (s *RemoteWalletSigner) Close() {
+	s.closer()
+}
+
+func (s *RemoteWalletSigner) SignerForMiner(ctx context.Context, miner uint64) (gpbft.Signer, error) {
+	addr := minerWalletAddress(miner)
+	has, err := s.api.WalletHas(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("querying remote wallet for miner %d: %w", miner, err)
+	}
+	if !has {
+		return nil, fmt.Errorf("remote wallet has no key for miner %d", miner)
+	}
+	return &remoteWalletGpbftSigner{api: &s.api, addr: addr}, nil
+}
+
+// remoteWalletGpbftSigner adapts RemoteWalletSigner to gpbft.Signer for an
+// already-resolved wallet address.
+type remoteWalletGpbftSigner struct {
+	api  *walletApi
+	addr string
+}
+
+func (r *remoteWalletGpbftSigner) Sign(ctx context.Context, sender gpbft.PubKey, msg []byte) ([]byte, error) {
+	sig, err := r.api.WalletSign(ctx, r.addr, msg, MsgMeta{Type: MTF3Message})
+	if err != nil {
+		return nil, err
+	}
+	return sig.Data, nil
+}
+
+// minerWalletAddress renders a miner actor ID as the "f0<id>" ID-address
+// that Lotus's Wallet API expects.
+func minerWalletAddress(miner uint64) string {
+	return fmt.Sprintf("f0%d", miner)
+}
+
+// FallbackSigner tries each backend in order for a given miner and signs
+// with the first one that can.
+type FallbackSigner struct {
+	backends []Signer
+}
+
+func NewFallbackSigner(backends ...Signer) *FallbackSigner {
+	return &FallbackSigner{backends: backends}
+}
+
+func (f *FallbackSigner) SignerForMiner(ctx context.Context, miner uint64) (gpbft.Signer, error) {
+	var lastErr error
+	for _, backend := range f.backends {
+		signer, err := backend.SignerForMiner(ctx, miner)
+		if err == nil {
+			return signer, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no signer backend available for miner %d: %w", miner, lastErr)
+}